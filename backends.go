@@ -0,0 +1,445 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// UploadMeta carries the per-request fields a Backend needs to build its
+// upload request. Not every backend uses every field (e.g. only litterbox
+// cares about TimeVal).
+type UploadMeta struct {
+	Filename string
+	Userhash string
+	TimeVal  string
+}
+
+// Backend knows how to upload a file to one remote host and parse its
+// response into a URL. Implementations live in this file; new hosts are
+// added by implementing the interface and calling RegisterBackend in init().
+type Backend interface {
+	Name() string
+	BuildRequest(r io.Reader, meta UploadMeta) (*http.Request, error)
+	ParseResponse(body []byte) (string, error)
+}
+
+var backendRegistry = map[string]Backend{}
+
+func RegisterBackend(b Backend) {
+	backendRegistry[b.Name()] = b
+}
+
+func getBackend(name string) (Backend, bool) {
+	b, ok := backendRegistry[name]
+	return b, ok
+}
+
+// listBackendNames returns every registered backend name, sorted for
+// deterministic mirror ordering.
+func listBackendNames() []string {
+	names := make([]string, 0, len(backendRegistry))
+	for name := range backendRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// failoverChains maps a requested destination to the ordered list of
+// backends to try. The requested destination is always tried first.
+var failoverChains = map[string][]string{
+	"catbox": {"catbox", "pomf"},
+	"pomf":   {"pomf", "catbox"},
+	// litterbox uploads are ephemeral (time-limited) and not cached, so
+	// there's no compatible fallback to substitute for it.
+	"litterbox": {"litterbox"},
+}
+
+func init() {
+	RegisterBackend(pomfBackend{})
+	RegisterBackend(catboxBackend{})
+	RegisterBackend(litterboxBackend{})
+}
+
+// backendHTTPError records the upstream status code so callers can decide
+// whether a failure is worth retrying against another backend.
+type backendHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *backendHTTPError) Error() string {
+	return fmt.Sprintf("upload failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func isRetryableErr(err error) bool {
+	var httpErr *backendHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// uploadToBackendReader streams r through b's multipart request and returns
+// the resulting URL. r is consumed exactly once.
+func uploadToBackendReader(b Backend, r io.Reader, meta UploadMeta) (string, error) {
+	req, err := b.BuildRequest(r, meta)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request for %s: %w", b.Name(), err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http request to %s failed: %w", b.Name(), err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body from %s: %w", b.Name(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &backendHTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return b.ParseResponse(respBody)
+}
+
+// uploadToBackend opens filePath and streams it to b. tracker, if non-nil,
+// is fed a byte count as the file is read so a GET /progress/{uploadId}
+// subscriber can report forwarding progress; it may be nil.
+func uploadToBackend(b Backend, filePath string, meta UploadMeta, tracker *progressTracker) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for streaming: %w", err)
+	}
+	defer file.Close()
+	if tracker != nil {
+		tracker.setPhase("forwarding")
+		return uploadToBackendReader(b, io.TeeReader(file, countingWriter{tracker}), meta)
+	}
+	return uploadToBackendReader(b, file, meta)
+}
+
+// uploadToBackendWithHash streams filePath to b exactly as uploadToBackend
+// does, but tees the bytes through a SHA-256 hasher as they're read so the
+// content hash falls out of the single upload pass instead of a separate
+// read of the file. tracker, if non-nil, is fed the same byte count.
+func uploadToBackendWithHash(b Backend, filePath string, meta UploadMeta, tracker *progressTracker) (url, hash string, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open file for streaming: %w", err)
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	hasher := sha256.New()
+	go func() {
+		dest := io.MultiWriter(pw, hasher, countingWriter{tracker})
+		_, copyErr := io.Copy(dest, file)
+		if copyErr != nil {
+			pw.CloseWithError(copyErr)
+		} else {
+			pw.Close()
+		}
+	}()
+
+	if tracker != nil {
+		tracker.setPhase("forwarding")
+	}
+	url, err = uploadToBackendReader(b, pr, meta)
+	if err != nil {
+		return "", "", err
+	}
+	return url, fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// forwardWithFailover tries destination first, then any compatible backends
+// in failoverChains, stopping at the first success or the first
+// non-retryable error. It returns the name of the backend that actually
+// served the file, which may differ from destination. tracker may be nil.
+func forwardWithFailover(destination, filePath string, meta UploadMeta, tracker *progressTracker) (servedBy, url string, err error) {
+	chain, ok := failoverChains[destination]
+	if !ok {
+		chain = []string{destination}
+	}
+	var lastErr error
+	for i, name := range chain {
+		b, ok := getBackend(name)
+		if !ok {
+			lastErr = fmt.Errorf("destination '%s' is not supported", name)
+			continue
+		}
+		if i > 0 && tracker != nil {
+			tracker.resetSent()
+		}
+		url, err := uploadToBackend(b, filePath, meta, tracker)
+		if err == nil {
+			return name, url, nil
+		}
+		lastErr = err
+		if !isRetryableErr(err) {
+			return "", "", err
+		}
+	}
+	return "", "", lastErr
+}
+
+// forwardWithFailoverHashed behaves like forwardWithFailover, but also
+// returns the SHA-256 of the uploaded content. If knownHash is non-empty
+// (the chunked upload path already derived it from its per-chunk sidecar),
+// it's returned as-is instead of being recomputed during the upload.
+// tracker may be nil.
+func forwardWithFailoverHashed(destination, filePath string, meta UploadMeta, knownHash string, tracker *progressTracker) (servedBy, url, hash string, err error) {
+	chain, ok := failoverChains[destination]
+	if !ok {
+		chain = []string{destination}
+	}
+	var lastErr error
+	for i, name := range chain {
+		b, ok := getBackend(name)
+		if !ok {
+			lastErr = fmt.Errorf("destination '%s' is not supported", name)
+			continue
+		}
+		if i > 0 && tracker != nil {
+			tracker.resetSent()
+		}
+		if knownHash != "" {
+			url, err := uploadToBackend(b, filePath, meta, tracker)
+			if err == nil {
+				return name, url, knownHash, nil
+			}
+			lastErr = err
+		} else {
+			url, hash, err := uploadToBackendWithHash(b, filePath, meta, tracker)
+			if err == nil {
+				return name, url, hash, nil
+			}
+			lastErr = err
+		}
+		if !isRetryableErr(lastErr) {
+			return "", "", "", lastErr
+		}
+	}
+	return "", "", "", lastErr
+}
+
+// MirrorResult is one backend's outcome from a mirrored upload.
+type MirrorResult struct {
+	Backend string `json:"backend"`
+	URL     string `json:"url,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// mirrorUploadHashed streams filePath to every named backend concurrently
+// using a single read of the file fanned out via io.MultiWriter, so the
+// upload cost doesn't scale with the number of mirrors. It also returns the
+// content's SHA-256, folding the hasher into the same fan-out rather than
+// hashing the file in a separate pass. If knownHash is non-empty it's
+// returned as-is instead. tracker may be nil.
+func mirrorUploadHashed(names []string, filePath string, meta UploadMeta, knownHash string, tracker *progressTracker) ([]MirrorResult, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open file for mirroring: %w", err)
+	}
+	defer file.Close()
+
+	var backends []Backend
+	var writers []io.Writer
+	var readers []*io.PipeReader
+	var pipeWriters []*io.PipeWriter
+	for _, name := range names {
+		b, ok := getBackend(name)
+		if !ok {
+			continue
+		}
+		pr, pw := io.Pipe()
+		backends = append(backends, b)
+		writers = append(writers, pw)
+		readers = append(readers, pr)
+		pipeWriters = append(pipeWriters, pw)
+	}
+	if len(backends) == 0 {
+		return nil, "", fmt.Errorf("no valid backends requested for mirroring")
+	}
+
+	hasher := sha256.New()
+	if knownHash == "" {
+		writers = append(writers, hasher)
+	}
+	writers = append(writers, countingWriter{tracker})
+
+	if tracker != nil {
+		tracker.setPhase("forwarding")
+	}
+	go func() {
+		_, copyErr := io.Copy(io.MultiWriter(writers...), file)
+		for _, pw := range pipeWriters {
+			if copyErr != nil {
+				pw.CloseWithError(copyErr)
+			} else {
+				pw.Close()
+			}
+		}
+	}()
+
+	results := make([]MirrorResult, len(backends))
+	done := make(chan struct{})
+	for i := range backends {
+		go func(i int) {
+			url, err := uploadToBackendReader(backends[i], readers[i], meta)
+			if err != nil {
+				results[i] = MirrorResult{Backend: backends[i].Name(), Error: err.Error()}
+			} else {
+				results[i] = MirrorResult{Backend: backends[i].Name(), URL: url}
+			}
+			done <- struct{}{}
+		}(i)
+	}
+	for range backends {
+		<-done
+	}
+
+	hash := knownHash
+	if hash == "" {
+		hash = fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+	return results, hash, nil
+}
+
+// --- pomf ---
+
+type pomfBackend struct{}
+
+func (pomfBackend) Name() string { return "pomf" }
+
+func (pomfBackend) BuildRequest(r io.Reader, meta UploadMeta) (*http.Request, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		defer pw.Close()
+		defer writer.Close()
+		part, err := writer.CreateFormFile("files[]", meta.Filename)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create form file part: %w", err))
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to stream file content: %w", err))
+			return
+		}
+	}()
+	req, err := http.NewRequest("POST", "https://pomf.lain.la/upload.php", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
+func (pomfBackend) ParseResponse(body []byte) (string, error) {
+	var result struct {
+		Success bool `json:"success"`
+		Files   []struct {
+			URL string `json:"url"`
+		} `json:"files"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse pomf response: %w", err)
+	}
+	if !result.Success {
+		return "", fmt.Errorf("pomf upload failed: %s", result.Error)
+	}
+	if len(result.Files) > 0 {
+		return result.Files[0].URL, nil
+	}
+	return "", fmt.Errorf("pomf response missing file URL")
+}
+
+// --- catbox ---
+
+type catboxBackend struct{}
+
+func (catboxBackend) Name() string { return "catbox" }
+
+func (catboxBackend) BuildRequest(r io.Reader, meta UploadMeta) (*http.Request, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		defer pw.Close()
+		defer writer.Close()
+		writer.WriteField("reqtype", "fileupload")
+		if meta.Userhash != "" {
+			writer.WriteField("userhash", meta.Userhash)
+		}
+		part, err := writer.CreateFormFile("fileToUpload", meta.Filename)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create form file part: %w", err))
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to stream file content: %w", err))
+			return
+		}
+	}()
+	req, err := http.NewRequest("POST", "https://catbox.moe/user/api.php", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
+func (catboxBackend) ParseResponse(body []byte) (string, error) {
+	return string(body), nil
+}
+
+// --- litterbox ---
+
+type litterboxBackend struct{}
+
+func (litterboxBackend) Name() string { return "litterbox" }
+
+func (litterboxBackend) BuildRequest(r io.Reader, meta UploadMeta) (*http.Request, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		defer pw.Close()
+		defer writer.Close()
+		writer.WriteField("reqtype", "fileupload")
+		writer.WriteField("time", meta.TimeVal)
+		part, err := writer.CreateFormFile("fileToUpload", meta.Filename)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create form file part: %w", err))
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to stream file content: %w", err))
+			return
+		}
+	}()
+	req, err := http.NewRequest("POST", "https://litterbox.catbox.moe/resources/internals/api.php", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
+func (litterboxBackend) ParseResponse(body []byte) (string, error) {
+	return string(body), nil
+}
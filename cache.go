@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	cacheDir = "/tmp/cache"
+
+	defaultCacheMaxBytes    = 10 << 30  // total cache size before eviction kicks in
+	defaultCacheMaxFileSize = 512 << 20 // per-file admission cap; bigger responses pass through uncached
+	defaultCacheEvictEvery  = 10 * time.Minute
+)
+
+// errNotCacheable marks a fetch that succeeded but shouldn't be written to
+// the cache (non-200 status or over the per-file size cap), so the caller
+// falls back to a plain passthrough instead of treating it as an error.
+var errNotCacheable = errors.New("response not cacheable")
+
+// fetchGroup coalesces concurrent cache-populating fetches for the same
+// path, so a viral file behind /catbox/, /pomf/, or /litterbox/ is only
+// pulled from upstream once no matter how many clients are requesting it
+// at the same moment.
+var fetchGroup singleflight.Group
+
+// cacheMaxFileBytes is the per-file admission cap, read once at startup
+// rather than on every cache-miss request.
+var cacheMaxFileBytes int64
+
+func init() {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		log.Fatalf("❌ Could not create cache directory: %v", err)
+	}
+	cacheMaxFileBytes = envBytes("CACHE_MAX_FILE_BYTES", defaultCacheMaxFileSize)
+	go runCacheEvictor(envBytes("CACHE_MAX_BYTES", defaultCacheMaxBytes), envDuration("CACHE_EVICT_INTERVAL", defaultCacheEvictEvery))
+}
+
+// envBytes parses name as a byte count, falling back to def if it's unset
+// or malformed.
+func envBytes(name string, def int64) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, falling back to %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// cacheKeyFor maps an upstream-relative path to a flat on-disk filename so
+// arbitrary characters (including path separators or "..") in the proxied
+// path can never escape cacheDir.
+func cacheKeyFor(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("%x", sum)
+}
+
+// openCachedFile opens path's cached copy, if any, and bumps its access
+// time so the LRU evictor sees it as recently used.
+func openCachedFile(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	touchAtime(path, info.ModTime())
+	return f, info, nil
+}
+
+// cachedHeaders is the subset of the original upstream response headers
+// worth preserving across a cache round-trip; http.ServeContent derives
+// Content-Type from the file extension on its own, but origins that set an
+// explicit Content-Type or Content-Disposition (e.g. forcing a download)
+// would otherwise lose that on every cache hit.
+type cachedHeaders struct {
+	ContentType        string `json:"contentType,omitempty"`
+	ContentDisposition string `json:"contentDisposition,omitempty"`
+}
+
+func headersSidecarPath(cachePath string) string {
+	return cachePath + ".headers.json"
+}
+
+func saveCachedHeaders(cachePath string, h http.Header) {
+	ch := cachedHeaders{ContentType: h.Get("Content-Type"), ContentDisposition: h.Get("Content-Disposition")}
+	if ch.ContentType == "" && ch.ContentDisposition == "" {
+		return
+	}
+	data, err := json.Marshal(ch)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(headersSidecarPath(cachePath), data, 0644); err != nil {
+		log.Printf("⚠️ Failed to write cache headers sidecar for %s: %v", filepath.Base(cachePath), err)
+	}
+}
+
+// applyCachedHeaders sets whatever response headers were preserved for
+// cachePath's content, if any, before ServeContent writes the body.
+func applyCachedHeaders(w http.ResponseWriter, cachePath string) {
+	data, err := os.ReadFile(headersSidecarPath(cachePath))
+	if err != nil {
+		return
+	}
+	var h cachedHeaders
+	if err := json.Unmarshal(data, &h); err != nil {
+		return
+	}
+	if h.ContentType != "" {
+		w.Header().Set("Content-Type", h.ContentType)
+	}
+	if h.ContentDisposition != "" {
+		w.Header().Set("Content-Disposition", h.ContentDisposition)
+	}
+}
+
+// touchAtime bumps path's access time to now while leaving mtime (and
+// therefore the Last-Modified header ServeContent derives from it)
+// untouched. Many deployments mount with relatime/noatime, so this is set
+// explicitly rather than relied on from the filesystem.
+func touchAtime(path string, mtime time.Time) {
+	if err := os.Chtimes(path, time.Now(), mtime); err != nil {
+		log.Printf("⚠️ Failed to update access time for %s: %v", path, err)
+	}
+}
+
+// fileAtime reads back the access time touchAtime wrote. Falls back to
+// mtime when info.Sys() is not a *syscall.Stat_t. It reads Stat_t.Atim, so
+// it only builds on platforms whose Stat_t has that field (e.g. Linux).
+func fileAtime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+	}
+	return info.ModTime()
+}
+
+// populateCache fetches targetURL unranged and, if the response passes
+// cache admission (200 status, size under maxFileSize), writes it to a
+// temp file in cacheDir and renames it into place at cachePath atomically.
+// A response that fails admission returns errNotCacheable rather than an
+// error, so callers know to fall back to a direct passthrough instead of
+// reporting a failure.
+//
+// This fully downloads before createProxyHandler opens the cache file and
+// serves it, rather than tee-ing the upstream body straight into the
+// response while it's written to disk. A tee would have to either ignore
+// the client's Range header on a cold cache (since admission and the
+// cached file's full bytes aren't known until the download completes) or
+// buffer enough of the response to re-derive ranges after the fact, which
+// gives up the exact thing http.ServeContent is being used for. A
+// first-request latency hit on an uncached file is the accepted trade-off
+// for every subsequent request — including ranged ones — being served
+// correctly from disk.
+func populateCache(targetURL, cachePath string, maxFileSize int64) error {
+	resp, err := httpClient.Get(targetURL)
+	if err != nil {
+		return fmt.Errorf("upstream fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errNotCacheable
+	}
+	if resp.ContentLength > 0 && resp.ContentLength > maxFileSize {
+		return errNotCacheable
+	}
+
+	tmp, err := os.CreateTemp(cacheDir, "fetch-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, copyErr := io.Copy(tmp, io.LimitReader(resp.Body, maxFileSize+1))
+	if closeErr := tmp.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to write cache file: %w", copyErr)
+	}
+	if written > maxFileSize {
+		return errNotCacheable
+	}
+
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return err
+	}
+	saveCachedHeaders(cachePath, resp.Header)
+	return nil
+}
+
+// runCacheEvictor periodically walks cacheDir and, if it's over maxBytes,
+// deletes the least-recently-accessed entries until it's back under cap.
+func runCacheEvictor(maxBytes int64, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if err := evictCacheIfOverCap(maxBytes); err != nil {
+			log.Printf("⚠️ Cache eviction failed: %v", err)
+		}
+	}
+}
+
+type cacheFile struct {
+	path  string
+	size  int64
+	atime time.Time
+}
+
+func evictCacheIfOverCap(maxBytes int64) error {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", cacheDir, err)
+	}
+
+	var files []cacheFile
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") || strings.HasSuffix(e.Name(), ".headers.json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(cacheDir, e.Name())
+		files = append(files, cacheFile{path: path, size: info.Size(), atime: fileAtime(info)})
+		total += info.Size()
+	}
+	if total <= maxBytes {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].atime.Before(files[j].atime) })
+	for _, f := range files {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("⚠️ Failed to evict cache entry %s: %v", filepath.Base(f.path), err)
+			continue
+		}
+		os.Remove(headersSidecarPath(f.path))
+		total -= f.size
+		log.Printf("🧹 Evicted cache entry %s (%s) to stay under the %s cap", filepath.Base(f.path), formatBytes(f.size), formatBytes(maxBytes))
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hashSidecarName is the per-upload file tracking the running SHA-256 state
+// built up as chunks land, so finishHandler can read off the final digest
+// without re-reading the assembled file.
+const hashSidecarName = "hash.sidecar"
+
+// hashSidecar is the on-disk representation of the running hash state.
+// NextIndex is the chunk index the hash chain is expecting next; once it
+// reaches the total chunk count, State reflects the complete file's digest.
+type hashSidecar struct {
+	NextIndex int    `json:"nextIndex"`
+	State     []byte `json:"state,omitempty"`
+}
+
+func loadHashSidecar(uploadPath string) hashSidecar {
+	data, err := os.ReadFile(filepath.Join(uploadPath, hashSidecarName))
+	if err != nil {
+		return hashSidecar{}
+	}
+	var s hashSidecar
+	if err := json.Unmarshal(data, &s); err != nil {
+		return hashSidecar{}
+	}
+	return s
+}
+
+func saveHashSidecar(uploadPath string, s hashSidecar) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hash sidecar: %w", err)
+	}
+	tmpPath := filepath.Join(uploadPath, hashSidecarName+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash sidecar: %w", err)
+	}
+	return os.Rename(tmpPath, filepath.Join(uploadPath, hashSidecarName))
+}
+
+// prepareHasherForChunk returns a hasher primed with the running digest
+// state, ready to have chunk idx's bytes written into it. The second
+// return value is false when idx isn't the next chunk the chain expects
+// (out-of-order arrival), in which case the caller should skip hashing
+// this chunk entirely rather than poison the chain.
+func prepareHasherForChunk(uploadPath string, idx int) (hash.Hash, bool) {
+	sidecar := loadHashSidecar(uploadPath)
+	if idx != sidecar.NextIndex {
+		return nil, false
+	}
+	hasher := sha256.New()
+	if sidecar.State != nil {
+		if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(sidecar.State); err != nil {
+			return nil, false
+		}
+	}
+	return hasher, true
+}
+
+// commitHasher persists hasher's state after chunk idx has been written
+// into it, advancing the sidecar's expected next index.
+func commitHasher(uploadPath string, idx int, hasher hash.Hash) error {
+	state, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot hash state: %w", err)
+	}
+	return saveHashSidecar(uploadPath, hashSidecar{NextIndex: idx + 1, State: state})
+}
+
+// finalizeHashSidecar returns the completed file's hex digest if the sidecar
+// saw every chunk from 0..totalChunks-1 in order, and false otherwise.
+func finalizeHashSidecar(uploadPath string, totalChunks int) (string, bool) {
+	sidecar := loadHashSidecar(uploadPath)
+	if sidecar.State == nil || sidecar.NextIndex != totalChunks {
+		return "", false
+	}
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(sidecar.State); err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), true
+}
+
+// manifestFileName is the per-upload file describing the upload's shape.
+// It's written once, when the first chunk for an uploadId arrives, and is
+// immutable for the rest of the upload's life.
+const manifestFileName = "manifest.json"
+
+// uploadManifest is the on-disk description of an in-flight chunked
+// upload. It lets a resuming client (and the HEAD /chunk endpoint) learn
+// what the upload looks like without the client having to resend it, and
+// lets the janitor decide when an abandoned upload directory is stale.
+type uploadManifest struct {
+	Filename    string    `json:"filename"`
+	TotalChunks int       `json:"totalChunks"`
+	ChunkSize   int64     `json:"chunkSize"`
+	TotalSize   int64     `json:"totalSize"`
+	SHA256      string    `json:"sha256,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func loadManifest(uploadPath string) (uploadManifest, error) {
+	data, err := os.ReadFile(filepath.Join(uploadPath, manifestFileName))
+	if err != nil {
+		return uploadManifest{}, err
+	}
+	var m uploadManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return uploadManifest{}, err
+	}
+	return m, nil
+}
+
+// writeManifestIfAbsent creates uploadPath's manifest the first time a
+// chunk arrives for it. Later chunks are no-ops here since the manifest is
+// fixed for the life of the upload.
+func writeManifestIfAbsent(uploadPath string, m uploadManifest) error {
+	manifestPath := filepath.Join(uploadPath, manifestFileName)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	tmpPath := manifestPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return os.Rename(tmpPath, manifestPath)
+}
+
+// newManifestFromForm builds the manifest for a new chunked upload from the
+// fields submitted alongside its first chunk.
+func newManifestFromForm(filename, totalChunksStr, chunkSizeStr, totalSizeStr, sha256Hex string) (uploadManifest, error) {
+	totalChunks, err := strconv.Atoi(totalChunksStr)
+	if err != nil || totalChunks <= 0 {
+		return uploadManifest{}, fmt.Errorf("missing or invalid totalChunks")
+	}
+	chunkSize, err := strconv.ParseInt(chunkSizeStr, 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return uploadManifest{}, fmt.Errorf("missing or invalid chunkSize")
+	}
+	totalSize, err := strconv.ParseInt(totalSizeStr, 10, 64)
+	if err != nil || totalSize < 0 {
+		return uploadManifest{}, fmt.Errorf("missing or invalid totalSize")
+	}
+	return uploadManifest{
+		Filename:    filename,
+		TotalChunks: totalChunks,
+		ChunkSize:   chunkSize,
+		TotalSize:   totalSize,
+		SHA256:      sha256Hex,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// chunkStatus describes one chunk already on disk, as reported by
+// HEAD /chunk.
+type chunkStatus struct {
+	Index int   `json:"index"`
+	Size  int64 `json:"size"`
+}
+
+// receivedChunks reads uploadPath's directory and returns the chunk
+// indices and sizes already received, sorted by index, so a resuming
+// client knows what it still needs to send.
+func receivedChunks(uploadPath string) ([]chunkStatus, error) {
+	entries, err := os.ReadDir(uploadPath)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]chunkStatus, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "chunk_") {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimPrefix(e.Name(), "chunk_"))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		chunks = append(chunks, chunkStatus{Index: idx, Size: info.Size()})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	return chunks, nil
+}
+
+// validateManifestComplete checks that uploadPath holds exactly the chunk
+// indices manifest declared (0..TotalChunks-1 with no gaps), so
+// finishHandler can't assemble a truncated file just because some chunk
+// count happens to match — a missing interior chunk with a surplus one
+// elsewhere would otherwise slip through a plain count comparison.
+func validateManifestComplete(uploadPath string, manifest uploadManifest) error {
+	received, err := receivedChunks(uploadPath)
+	if err != nil {
+		return fmt.Errorf("failed to read upload directory: %w", err)
+	}
+	if len(received) != manifest.TotalChunks {
+		return fmt.Errorf("upload incomplete: expected %d chunks, received %d", manifest.TotalChunks, len(received))
+	}
+	for i, c := range received {
+		if c.Index != i {
+			return fmt.Errorf("upload incomplete: missing chunk %d", i)
+		}
+	}
+	return nil
+}
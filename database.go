@@ -10,12 +10,6 @@ import (
 
 var db *sql.DB
 
-type FileHashRecord struct {
-	Hash      string
-	CatboxURL sql.NullString
-	PomfURL   sql.NullString
-}
-
 func InitDB() error {
 	dbURI := os.Getenv("DATABASE_URI")
 	if dbURI == "" {
@@ -41,49 +35,48 @@ func InitDB() error {
 
 func createTableIfNotExists() error {
 	query := `
-    CREATE TABLE IF NOT EXISTS hash (
-        hash CHAR(64) PRIMARY KEY,
-        catbox TEXT,
-        pomf TEXT,
-        created_at TIMESTAMPTZ DEFAULT NOW()
+    CREATE TABLE IF NOT EXISTS hash_urls (
+        hash CHAR(64) NOT NULL,
+        backend TEXT NOT NULL,
+        url TEXT NOT NULL,
+        created_at TIMESTAMPTZ DEFAULT NOW(),
+        PRIMARY KEY (hash, backend)
     );`
 	_, err := db.Exec(query)
 	return err
 }
 
-func GetURLsByHash(hash string) (FileHashRecord, error) {
-	var record FileHashRecord
-	record.Hash = hash
+// GetURLsByHash returns every backend URL cached for hash, keyed by backend
+// name. A hash with no cached uploads yet returns an empty, non-nil map.
+func GetURLsByHash(hash string) (map[string]string, error) {
+	urls := make(map[string]string)
 
-	query := "SELECT catbox, pomf FROM hash WHERE hash = $1 LIMIT 1;"
-	err := db.QueryRow(query, hash).Scan(&record.CatboxURL, &record.PomfURL)
+	rows, err := db.Query("SELECT backend, url FROM hash_urls WHERE hash = $1;", hash)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return record, nil
+		return nil, fmt.Errorf("database query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var backend, url string
+		if err := rows.Scan(&backend, &url); err != nil {
+			return nil, fmt.Errorf("database scan failed: %w", err)
 		}
-		return record, fmt.Errorf("database query failed: %w", err)
+		urls[backend] = url
 	}
-	return record, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database query failed: %w", err)
+	}
+	return urls, nil
 }
 
-func storeUrl(hash, destination, url string) error {
-	var query string
-	switch destination {
-	case "catbox":
-		query = `
-        INSERT INTO hash (hash, catbox)
-        VALUES ($1, $2)
-        ON CONFLICT (hash) DO UPDATE SET catbox = EXCLUDED.catbox;`
-	case "pomf":
-		query = `
-        INSERT INTO hash (hash, pomf)
-        VALUES ($1, $2)
-        ON CONFLICT (hash) DO UPDATE SET pomf = EXCLUDED.pomf;`
-	default:
-		return fmt.Errorf("cannot store URL for unsupported destination: %s", destination)
-	}
+func storeUrl(hash, backend, url string) error {
+	query := `
+    INSERT INTO hash_urls (hash, backend, url)
+    VALUES ($1, $2, $3)
+    ON CONFLICT (hash, backend) DO UPDATE SET url = EXCLUDED.url, created_at = NOW();`
 
-	_, err := db.Exec(query, hash, url)
+	_, err := db.Exec(query, hash, backend, url)
 	if err != nil {
 		return fmt.Errorf("database insert/update failed: %w", err)
 	}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressEvent is one snapshot emitted on a GET /progress/{uploadId}
+// stream. Phase is empty and URL/Error are set only on the terminal event.
+// Zero-valued fields are omitted, so a progress event carries no "sent"
+// until the first byte has been forwarded (and no "total" for an empty file).
+type progressEvent struct {
+	Sent  int64  `json:"sent,omitempty"`
+	Total int64  `json:"total,omitempty"`
+	Phase string `json:"phase,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// progressRetention is how long a finished tracker is kept around after
+// finish() so a subscriber that connects slightly late can still read the
+// terminal event, before it's swept from the registry.
+const progressRetention = 1 * time.Minute
+
+// progressTracker reports one upload's forwarding progress to whatever
+// GET /progress/{uploadId} subscriber shows up, without the upload path
+// blocking on a reader ever connecting. sent is updated from the upload's
+// own copy loop via a countingWriter; final is set once by finish and read
+// repeatedly by the SSE handler's poll loop.
+type progressTracker struct {
+	uploadId string
+	sent     int64 // atomic
+	total    int64
+	phase    atomic.Value // string
+
+	mu    sync.Mutex
+	final *progressEvent
+}
+
+func newProgressTracker(uploadId string, total int64) *progressTracker {
+	t := &progressTracker{uploadId: uploadId, total: total}
+	t.phase.Store("hashing")
+	return t
+}
+
+func (t *progressTracker) setPhase(phase string) {
+	t.phase.Store(phase)
+}
+
+func (t *progressTracker) add(n int64) {
+	atomic.AddInt64(&t.sent, n)
+}
+
+// resetSent zeroes the sent counter. Callers retrying an upload against a
+// different backend after a failover must call this before the retry, or
+// the retry's bytes accumulate on top of the failed attempt's and a GET
+// /progress/{uploadId} subscriber can observe sent > total.
+func (t *progressTracker) resetSent() {
+	atomic.StoreInt64(&t.sent, 0)
+}
+
+func (t *progressTracker) snapshot() progressEvent {
+	return progressEvent{
+		Sent:  atomic.LoadInt64(&t.sent),
+		Total: t.total,
+		Phase: t.phase.Load().(string),
+	}
+}
+
+// finish records the terminal event for this upload. Once set, every
+// subsequent poll of finalEvent returns it. The tracker is swept from the
+// registry after progressRetention so a late GET /progress/{uploadId}
+// subscriber still has a window to read it even if progressHandler's own
+// post-delivery cleanup never runs (no subscriber ever connected).
+func (t *progressTracker) finish(url string, err error) {
+	ev := &progressEvent{URL: url}
+	if err != nil {
+		ev = &progressEvent{Error: err.Error()}
+	}
+	t.mu.Lock()
+	t.final = ev
+	t.mu.Unlock()
+	time.AfterFunc(progressRetention, func() { removeProgressTracker(t.uploadId) })
+}
+
+func (t *progressTracker) finalEvent() *progressEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.final
+}
+
+// countingWriter increments a tracker's sent counter as bytes flow through
+// it, so forwarding progress falls out of the existing upload copy rather
+// than a separate instrumented pass. A nil tracker makes it a no-op sink.
+type countingWriter struct {
+	tracker *progressTracker
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	if c.tracker != nil {
+		c.tracker.add(int64(len(p)))
+	}
+	return len(p), nil
+}
+
+var (
+	progressMu       sync.Mutex
+	progressTrackers = make(map[string]*progressTracker)
+)
+
+// registerProgressTracker creates and registers the tracker for uploadId.
+func registerProgressTracker(uploadId string, total int64) *progressTracker {
+	t := newProgressTracker(uploadId, total)
+	progressMu.Lock()
+	progressTrackers[uploadId] = t
+	progressMu.Unlock()
+	return t
+}
+
+func getProgressTracker(uploadId string) (*progressTracker, bool) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	t, ok := progressTrackers[uploadId]
+	return t, ok
+}
+
+func removeProgressTracker(uploadId string) {
+	progressMu.Lock()
+	delete(progressTrackers, uploadId)
+	progressMu.Unlock()
+}
+
+// progressPollInterval is how often progressHandler checks the tracker for
+// new state and pushes an SSE event.
+const progressPollInterval = 200 * time.Millisecond
+
+// progressHandler streams GET /progress/{uploadId} as text/event-stream,
+// emitting `data: {"sent":N,"total":M,"phase":"..."}` events until the
+// upload finishes, then a terminal `data: {"url":"..."}` (or `{"error":
+// "..."}`) event before closing the connection.
+func progressHandler(w http.ResponseWriter, r *http.Request) {
+	uploadId := strings.TrimPrefix(r.URL.Path, "/progress/")
+	if uploadId == "" {
+		http.Error(w, "Missing uploadId", http.StatusBadRequest)
+		return
+	}
+	tracker, ok := getProgressTracker(uploadId)
+	if !ok {
+		http.Error(w, "Unknown uploadId", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(progressPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if final := tracker.finalEvent(); final != nil {
+				writeSSEEvent(w, *final)
+				flusher.Flush()
+				removeProgressTracker(uploadId)
+				return
+			}
+			writeSSEEvent(w, tracker.snapshot())
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev progressEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -23,6 +22,11 @@ const (
 	tempDir    = "/tmp/temp"
 )
 
+const (
+	defaultUploadTTL       = 24 * time.Hour
+	defaultJanitorInterval = 10 * time.Minute
+)
+
 func init() {
 	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
 		log.Fatalf("❌ Could not create uploads directory: %v", err)
@@ -34,28 +38,113 @@ func init() {
 		log.Fatalf("❌ Could not initialize database: %v", err)
 	}
 	log.Println("✅ Database connection successful.")
+	go runUploadJanitor(envDuration("UPLOAD_TTL", defaultUploadTTL), envDuration("JANITOR_INTERVAL", defaultJanitorInterval))
 }
 
-func calculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// envDuration parses name as a Go duration string (e.g. "24h"), falling
+// back to def if it's unset or malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
 	if err != nil {
-		return "", err
+		log.Printf("⚠️ Invalid %s=%q, falling back to %s", name, v, def)
+		return def
 	}
-	defer file.Close()
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return "", err
+	return d
+}
+
+// runUploadJanitor periodically deletes chunk upload directories whose
+// manifest is older than ttl. Uploads that finish normally are already
+// cleaned up by finishHandler's defer, so anything left behind past ttl
+// was abandoned mid-upload.
+func runUploadJanitor(ttl, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		entries, err := os.ReadDir(uploadsDir)
+		if err != nil {
+			log.Printf("⚠️ Janitor failed to list %s: %v", uploadsDir, err)
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			uploadPath := filepath.Join(uploadsDir, e.Name())
+			manifest, err := loadManifest(uploadPath)
+			if err != nil {
+				continue
+			}
+			if time.Since(manifest.CreatedAt) > ttl {
+				if err := os.RemoveAll(uploadPath); err != nil {
+					log.Printf("⚠️ Janitor failed to remove %s: %v", uploadPath, err)
+				} else {
+					log.Printf("🧹 Janitor removed abandoned upload %s", e.Name())
+				}
+			}
+		}
 	}
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
-func processAndForwardFile(w http.ResponseWriter, filePath, filename, userhash, destination, timeVal string) {
+// processAndForwardFile streams filePath to destination (or to every backend,
+// if mirror is set) and records the result in the hash cache. knownHash, if
+// non-empty, is used instead of hashing filePath again — the chunked upload
+// path already derives it from the per-chunk sidecar in finishHandler.
+// tracker, if non-nil, is updated with forwarding progress and given the
+// terminal result so a GET /progress/{uploadId} subscriber can report it.
+// headerSent must be true when the caller already committed a 200 status
+// line (directHandler flushes one early so it can hand back X-Upload-Id
+// before the upload finishes) — in that case a failure can no longer be
+// reported via the status code, so it's reported in a JSON body instead.
+func processAndForwardFile(w http.ResponseWriter, filePath, filename, userhash, destination, timeVal string, mirror bool, knownHash string, tracker *progressTracker, headerSent bool) {
+	meta := UploadMeta{Filename: filename, Userhash: userhash, TimeVal: timeVal}
+	writeUploadError := func(err error) {
+		if headerSent {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+	}
+
+	if mirror {
+		names := listBackendNames()
+		results, hash, err := mirrorUploadHashed(names, filePath, meta, knownHash, tracker)
+		if err != nil {
+			log.Printf("❌ Mirror upload error: %v", err)
+			if tracker != nil {
+				tracker.finish("", err)
+			}
+			writeUploadError(err)
+			return
+		}
+		for _, res := range results {
+			if res.Error == "" && res.Backend != "litterbox" {
+				if err := storeUrl(hash, res.Backend, res.URL); err != nil {
+					log.Printf("⚠️ Failed to store hash %s for backend %s in database: %v", hash[:10], res.Backend, err)
+				}
+			}
+		}
+		log.Printf("🪞 Mirrored upload of %s to %d backends", filename, len(results))
+		if tracker != nil {
+			tracker.finish(fmt.Sprintf("%d backends mirrored", len(results)), nil)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
 	if destination == "litterbox" {
 		log.Printf("🗑️ Litterbox file will not be cached. Proceeding with direct upload.")
-		url, err := forwardToDestination(destination, filePath, filename, userhash, timeVal)
+		_, url, err := forwardWithFailover(destination, filePath, meta, tracker)
+		if tracker != nil {
+			tracker.finish(url, err)
+		}
 		if err != nil {
 			log.Printf("❌ Upload error to litterbox: %v", err)
-			http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+			writeUploadError(err)
 			return
 		}
 		log.Printf("🚀 Uploaded to %s: %s", destination, url)
@@ -64,47 +153,33 @@ func processAndForwardFile(w http.ResponseWriter, filePath, filename, userhash,
 		return
 	}
 
-	hash, err := calculateFileHash(filePath)
+	servedBy, url, hash, err := forwardWithFailoverHashed(destination, filePath, meta, knownHash, tracker)
 	if err != nil {
-		log.Printf("❌ Failed to calculate file hash for %s: %v", filename, err)
-		http.Error(w, "Failed to calculate file hash", http.StatusInternalServerError)
-		return
-	}
-
-	record, err := GetURLsByHash(hash)
-	if err != nil {
-		log.Printf("❌ Database lookup failed for hash %s: %v", hash[:10], err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("❌ Upload error to %s: %v", destination, err)
+		if tracker != nil {
+			tracker.finish("", err)
+		}
+		writeUploadError(err)
 		return
 	}
-
-	var cachedURL string
-	if destination == "catbox" && record.CatboxURL.Valid {
-		cachedURL = record.CatboxURL.String
-	} else if destination == "pomf" && record.PomfURL.Valid {
-		cachedURL = record.PomfURL.String
+	if servedBy != destination {
+		log.Printf("♻️ %s was unavailable; %s served the file instead", destination, servedBy)
 	}
 
-	if cachedURL != "" {
-		log.Printf("✅ Cache hit for hash %s on destination %s. Returning stored URL.", hash[:10], destination)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"url": cachedURL})
-		return
-	}
-
-	log.Printf("🔍 Cache miss for hash %s on destination %s. Uploading...", hash[:10], destination)
-	url, err := forwardToDestination(destination, filePath, filename, userhash, timeVal)
+	cached, err := GetURLsByHash(hash)
 	if err != nil {
-		log.Printf("❌ Upload error for hash %s to %s: %v", hash[:10], destination, err)
-		http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("⚠️ Database lookup failed for hash %s: %v", hash[:10], err)
+	} else if cachedURL, ok := cached[servedBy]; ok {
+		log.Printf("✅ Hash %s for %s was already cached by a concurrent upload; reusing it.", hash[:10], servedBy)
+		url = cachedURL
+	} else if err := storeUrl(hash, servedBy, url); err != nil {
+		log.Printf("⚠️ Failed to store hash %s for destination %s in database: %v", hash[:10], servedBy, err)
 	}
 
-	if err := storeUrl(hash, destination, url); err != nil {
-		log.Printf("⚠️ Failed to store hash %s for destination %s in database: %v", hash[:10], destination, err)
+	if tracker != nil {
+		tracker.finish(url, nil)
 	}
-
-	log.Printf("🚀 Uploaded to %s: %s", destination, url)
+	log.Printf("🚀 Uploaded to %s: %s", servedBy, url)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"url": url})
 }
@@ -128,6 +203,10 @@ func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func chunkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		chunkStatusHandler(w, r)
+		return
+	}
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		http.Error(w, "Invalid form: "+err.Error(), http.StatusBadRequest)
 		return
@@ -138,7 +217,12 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing uploadId or index", http.StatusBadRequest)
 		return
 	}
-	file, _, err := r.FormFile("chunk")
+	idxNum, err := strconv.Atoi(index)
+	if err != nil {
+		http.Error(w, "Invalid index", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("chunk")
 	if err != nil {
 		http.Error(w, "Missing chunk file", http.StatusBadRequest)
 		return
@@ -149,6 +233,35 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
 		return
 	}
+
+	manifest, err := loadManifest(uploadPath)
+	if err != nil {
+		manifest, err = newManifestFromForm(r.FormValue("filename"), r.FormValue("totalChunks"), r.FormValue("chunkSize"), r.FormValue("totalSize"), r.FormValue("sha256"))
+		if err != nil {
+			// No manifest was ever written for uploadPath, so the janitor
+			// (which skips any directory it can't load a manifest for) would
+			// never reclaim it — remove the directory ourselves instead of
+			// leaking it.
+			os.RemoveAll(uploadPath)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := writeManifestIfAbsent(uploadPath, manifest); err != nil {
+			os.RemoveAll(uploadPath)
+			http.Error(w, "Failed to write manifest", http.StatusInternalServerError)
+			return
+		}
+	}
+	if idxNum < 0 || idxNum >= manifest.TotalChunks {
+		http.Error(w, "Chunk index out of range", http.StatusBadRequest)
+		return
+	}
+	isLastChunk := idxNum == manifest.TotalChunks-1
+	if !isLastChunk && header.Size != manifest.ChunkSize {
+		http.Error(w, fmt.Sprintf("Chunk %d size %d does not match declared chunk size %d", idxNum, header.Size, manifest.ChunkSize), http.StatusBadRequest)
+		return
+	}
+
 	chunkPath := filepath.Join(uploadPath, fmt.Sprintf("chunk_%s", index))
 	out, err := os.Create(chunkPath)
 	if err != nil {
@@ -156,10 +269,21 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer out.Close()
-	if _, err := io.Copy(out, file); err != nil {
+
+	hasher, hashable := prepareHasherForChunk(uploadPath, idxNum)
+	var dest io.Writer = out
+	if hashable {
+		dest = io.MultiWriter(out, hasher)
+	}
+	if _, err := io.Copy(dest, file); err != nil {
 		http.Error(w, "Failed to write chunk to disk", http.StatusInternalServerError)
 		return
 	}
+	if hashable {
+		if err := commitHasher(uploadPath, idxNum, hasher); err != nil {
+			log.Printf("⚠️ Failed to update hash sidecar for uploadId %s: %v", uploadId, err)
+		}
+	}
 	log.Printf("✅ Received chunk %s for uploadId: %s", index, uploadId)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -167,6 +291,33 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// chunkStatusHandler answers HEAD /chunk?uploadId=... with the manifest
+// and the chunk indices/sizes already on disk, so a client resuming an
+// interrupted upload knows exactly what it still needs to send.
+func chunkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	uploadId := r.URL.Query().Get("uploadId")
+	if uploadId == "" {
+		http.Error(w, "Missing uploadId", http.StatusBadRequest)
+		return
+	}
+	uploadPath := filepath.Join(uploadsDir, uploadId)
+	manifest, err := loadManifest(uploadPath)
+	if err != nil {
+		http.Error(w, "Unknown uploadId", http.StatusNotFound)
+		return
+	}
+	chunks, err := receivedChunks(uploadPath)
+	if err != nil {
+		http.Error(w, "Failed to read upload directory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"manifest": manifest,
+		"received": chunks,
+	})
+}
+
 func finishHandler(w http.ResponseWriter, r *http.Request) {
 	uploadId := r.FormValue("uploadId")
 	filename := r.FormValue("filename")
@@ -183,15 +334,42 @@ func finishHandler(w http.ResponseWriter, r *http.Request) {
 	chunkDir := filepath.Join(uploadsDir, uploadId)
 	defer os.RemoveAll(chunkDir)
 
-	finalPath, err := assembleChunks(chunkDir, filename)
+	manifest, err := loadManifest(chunkDir)
+	if err != nil {
+		http.Error(w, "Unknown or expired uploadId", http.StatusNotFound)
+		return
+	}
+	if err := validateManifestComplete(chunkDir, manifest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	finalPath, totalChunks, err := assembleChunks(chunkDir, filename)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer os.Remove(finalPath)
 
-	log.Printf("📦 Assembled file ready: %s", finalPath)
-	processAndForwardFile(w, finalPath, filename, userhash, destination, timeVal)
+	mirror := r.FormValue("mirror") == "true"
+
+	knownHash, ok := finalizeHashSidecar(chunkDir, totalChunks)
+	if ok {
+		log.Printf("📦 Assembled file ready: %s (hash known from chunk stream)", finalPath)
+	} else {
+		log.Printf("📦 Assembled file ready: %s (chunks arrived out of order; hash will be recomputed)", finalPath)
+	}
+
+	// The client already knows uploadId (it minted it for the chunk
+	// uploads), so it can start polling GET /progress/{uploadId} as soon
+	// as this request is sent — no need to hand it back in a header.
+	var total int64
+	if info, err := os.Stat(finalPath); err == nil {
+		total = info.Size()
+	}
+	tracker := registerProgressTracker(uploadId, total)
+
+	processAndForwardFile(w, finalPath, filename, userhash, destination, timeVal, mirror, knownHash, tracker, false)
 }
 
 func directHandler(w http.ResponseWriter, r *http.Request) {
@@ -234,17 +412,30 @@ func directHandler(w http.ResponseWriter, r *http.Request) {
 		timeVal = "1h"
 	}
 	userhash := r.FormValue("userhash")
+	mirror := r.FormValue("mirror") == "true"
 
 	log.Printf("📥 Direct upload received: %s → %s", header.Filename, destination)
 	log.Printf("🚀 Uploading to: %s (%s)", destination, formatBytes(size))
 
-	processAndForwardFile(w, tempPath, header.Filename, userhash, destination, timeVal)
+	// /direct has no uploadId of its own, so one is minted here and handed
+	// back in a header immediately (flushed ahead of the blocking upload)
+	// so the client can start polling GET /progress/{uploadId} right away.
+	uploadId := uuid.New().String()
+	tracker := registerProgressTracker(uploadId, size)
+	w.Header().Set("X-Upload-Id", uploadId)
+	w.Header().Set("Content-Type", "application/json")
+	if flusher, ok := w.(http.Flusher); ok {
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+	}
+
+	processAndForwardFile(w, tempPath, header.Filename, userhash, destination, timeVal, mirror, "", tracker, true)
 }
 
-func assembleChunks(chunkDir, filename string) (string, error) {
+func assembleChunks(chunkDir, filename string) (string, int, error) {
 	entries, err := os.ReadDir(chunkDir)
 	if err != nil {
-		return "", fmt.Errorf("no chunks found for %s: %w", filepath.Base(chunkDir), err)
+		return "", 0, fmt.Errorf("no chunks found for %s: %w", filepath.Base(chunkDir), err)
 	}
 	log.Printf("🔧 Reassembling chunks for uploadId %s...", filepath.Base(chunkDir))
 	var chunks []string
@@ -266,7 +457,7 @@ func assembleChunks(chunkDir, filename string) (string, error) {
 	finalPath := filepath.Join(tempDir, uniqueFinalName)
 	finalFile, err := os.Create(finalPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to create final file: %w", err)
+		return "", 0, fmt.Errorf("failed to create final file: %w", err)
 	}
 	defer finalFile.Close()
 
@@ -274,102 +465,15 @@ func assembleChunks(chunkDir, filename string) (string, error) {
 		chunkPath := filepath.Join(chunkDir, chunkName)
 		chunkFile, err := os.Open(chunkPath)
 		if err != nil {
-			return "", fmt.Errorf("error opening chunk %s for reading: %w", chunkName, err)
+			return "", 0, fmt.Errorf("error opening chunk %s for reading: %w", chunkName, err)
 		}
 		_, err = io.Copy(finalFile, chunkFile)
 		chunkFile.Close()
 		if err != nil {
-			return "", fmt.Errorf("error writing chunk %s to final file: %w", chunkName, err)
+			return "", 0, fmt.Errorf("error writing chunk %s to final file: %w", chunkName, err)
 		}
 	}
-	return finalPath, nil
-}
-
-func forwardToDestination(destination, filePath, filename, userhash, timeVal string) (string, error) {
-	pipeReader, pipeWriter := io.Pipe()
-	writer := multipart.NewWriter(pipeWriter)
-	go func() {
-		defer pipeWriter.Close()
-		defer writer.Close()
-		file, err := os.Open(filePath)
-		if err != nil {
-			pipeWriter.CloseWithError(fmt.Errorf("failed to open file for streaming: %w", err))
-			return
-		}
-		defer file.Close()
-		var part io.Writer
-		switch destination {
-		case "pomf":
-			part, err = writer.CreateFormFile("files[]", filename)
-		case "catbox", "litterbox":
-			writer.WriteField("reqtype", "fileupload")
-			if destination == "catbox" && userhash != "" {
-				writer.WriteField("userhash", userhash)
-			}
-			if destination == "litterbox" {
-				writer.WriteField("time", timeVal)
-			}
-			part, err = writer.CreateFormFile("fileToUpload", filename)
-		default:
-			pipeWriter.CloseWithError(fmt.Errorf("unknown destination: %s", destination))
-			return
-		}
-		if err != nil {
-			pipeWriter.CloseWithError(fmt.Errorf("failed to create form file part: %w", err))
-			return
-		}
-		if _, err := io.Copy(part, file); err != nil {
-			pipeWriter.CloseWithError(fmt.Errorf("failed to stream file content: %w", err))
-			return
-		}
-	}()
-	urlMap := map[string]string{
-		"pomf":      "https://pomf.lain.la/upload.php",
-		"catbox":    "https://catbox.moe/user/api.php",
-		"litterbox": "https://litterbox.catbox.moe/resources/internals/api.php",
-	}
-	url, ok := urlMap[destination]
-	if !ok {
-		return "", fmt.Errorf("destination '%s' is not supported", destination)
-	}
-	req, err := http.NewRequest("POST", url, pipeReader)
-	if err != nil {
-		return "", fmt.Errorf("failed to create http request: %w", err)
-	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	client := &http.Client{Timeout: 5 * time.Minute}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("http request failed: %w", err)
-	}
-	defer resp.Body.Close()
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(respBody))
-	}
-	if destination == "pomf" {
-		var result struct {
-			Success bool `json:"success"`
-			Files   []struct {
-				URL string `json:"url"`
-			} `json:"files"`
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(respBody, &result); err != nil {
-			return "", fmt.Errorf("failed to parse pomf response: %w", err)
-		}
-		if !result.Success {
-			return "", fmt.Errorf("pomf upload failed: %s", result.Error)
-		}
-		if len(result.Files) > 0 {
-			return result.Files[0].URL, nil
-		}
-		return "", fmt.Errorf("pomf response missing file URL")
-	}
-	return string(respBody), nil
+	return finalPath, len(chunks), nil
 }
 
 func formatBytes(bytes int64) string {
@@ -390,6 +494,14 @@ func formatBytes(bytes int64) string {
 	}
 }
 
+// createProxyHandler proxies GET requests for stripPrefix to targetHost,
+// backed by the on-disk cache in cache.go. A cached file is served via
+// http.ServeContent, which natively handles Range, If-Modified-Since, and
+// conditional requests. An uncached path is fetched unranged (concurrent
+// requests for the same path coalesce through fetchGroup) and, if it
+// passes cache admission, written to disk for this and future requests;
+// otherwise it falls back to a direct passthrough that forwards the
+// client's own Range header, just like an uncached proxy would.
 func createProxyHandler(targetHost, stripPrefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -402,37 +514,66 @@ func createProxyHandler(targetHost, stripPrefix string) http.HandlerFunc {
 			http.Error(w, "File path is missing.", http.StatusBadRequest)
 			return
 		}
-
 		targetURL := targetHost + filePath
-		log.Printf("Proxying %s to %s", r.URL.Path, targetURL)
+		cachePath := filepath.Join(cacheDir, cacheKeyFor(filePath))
 
-		req, err := http.NewRequest(http.MethodGet, targetURL, nil)
-		if err != nil {
-			log.Printf("❌ Proxy error for %s (creating request): %v", targetURL, err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if f, info, err := openCachedFile(cachePath); err == nil {
+			defer f.Close()
+			applyCachedHeaders(w, cachePath)
+			http.ServeContent(w, r, filePath, info.ModTime(), f)
 			return
 		}
 
-		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
-			req.Header.Set("Range", rangeHeader)
-		}
-
-		client := &http.Client{Timeout: 5 * time.Minute}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("❌ Proxy error for %s (executing request): %v", targetURL, err)
+		log.Printf("Proxying %s to %s", r.URL.Path, targetURL)
+		_, fetchErr, _ := fetchGroup.Do(cachePath, func() (interface{}, error) {
+			return nil, populateCache(targetURL, cachePath, cacheMaxFileBytes)
+		})
+		if fetchErr == nil {
+			if f, info, err := openCachedFile(cachePath); err == nil {
+				defer f.Close()
+				applyCachedHeaders(w, cachePath)
+				http.ServeContent(w, r, filePath, info.ModTime(), f)
+				return
+			}
+		} else if !errors.Is(fetchErr, errNotCacheable) {
+			log.Printf("❌ Proxy error for %s: %v", targetURL, fetchErr)
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 			return
 		}
-		defer resp.Body.Close()
 
-		for key, values := range resp.Header {
-			w.Header()[key] = values
-		}
+		proxyPassthrough(w, r, targetURL)
+	}
+}
 
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+// proxyPassthrough streams targetURL directly to w, forwarding the
+// client's Range header. Used when a response fails cache admission (too
+// large, non-200) so it still reaches the client without being buffered
+// to disk.
+func proxyPassthrough(w http.ResponseWriter, r *http.Request, targetURL string) {
+	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		log.Printf("❌ Proxy error for %s (creating request): %v", targetURL, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
 	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("❌ Proxy error for %s (executing request): %v", targetURL, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
 }
 
 func main() {
@@ -440,6 +581,7 @@ func main() {
 	http.HandleFunc("/chunk", chunkHandler)
 	http.HandleFunc("/finish", finishHandler)
 	http.HandleFunc("/direct", directHandler)
+	http.HandleFunc("/progress/", progressHandler)
 	http.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
 	http.HandleFunc("/catbox/", createProxyHandler("https://files.catbox.moe/", "/catbox/"))
 	http.HandleFunc("/litterbox/", createProxyHandler("https://litter.catbox.moe/", "/litterbox/"))